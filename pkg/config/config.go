@@ -0,0 +1,59 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Config holds the server's full configuration, loaded from the JSON
+// file at Path by Reload.
+type Config struct {
+	Path string `json:"-"`
+
+	BindAddr  string `json:"bind_addr,omitempty"`
+	PidFile   string `json:"pid_file,omitempty"`
+	ServerLog string `json:"server_log,omitempty"`
+
+	// LogFormat selects the Logger implementation ("text" or "json");
+	// LogLevel names its verbosity threshold. See logger.NewFromConfig
+	// and logger.ParseLevel.
+	LogFormat string `json:"log_format,omitempty"`
+	LogLevel  string `json:"log_level,omitempty"`
+
+	Listeners []ListenerConfig `json:"listeners,omitempty"`
+	RateLimit *RateLimitConfig `json:"rate_limit,omitempty"`
+
+	// ShutdownTimeout bounds, in seconds, how long a graceful shutdown or
+	// restart waits for in-flight requests to finish. unsetShutdownTimeout
+	// is the sentinel Reload seeds it with before parsing the
+	// configuration file, so that a file which doesn't set this key falls
+	// back to server.defaultShutdownTimeout; an explicit 0 in the file
+	// disables the deadline instead. See server.shutdownContext.
+	ShutdownTimeout int `json:"shutdown_timeout"`
+
+	Origins map[string]*OriginConfig `json:"origins,omitempty"`
+}
+
+// unsetShutdownTimeout is the value Reload seeds ShutdownTimeout with
+// before parsing the configuration file, distinguishing "not present in
+// the file" from an explicit 0.
+const unsetShutdownTimeout int = -1
+
+// Reload reads and parses the configuration file at Path, replacing the
+// receiver's fields with freshly parsed ones.
+func (c *Config) Reload() error {
+	data, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return fmt.Errorf("unable to read configuration file `%s': %s", c.Path, err)
+	}
+
+	path := c.Path
+	*c = Config{Path: path, ShutdownTimeout: unsetShutdownTimeout}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("unable to parse configuration file `%s': %s", c.Path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package config
+
+// ListenerConfig represents a single network listener exposed by the
+// server.
+type ListenerConfig struct {
+	Network string      `json:"network"`
+	Address string      `json:"address"`
+	TLS     *TLSConfig  `json:"tls,omitempty"`
+	ACME    *ACMEConfig `json:"acme,omitempty"`
+}
+
+// TLSConfig holds the certificate material used by a TLS-enabled
+// listener.
+type TLSConfig struct {
+	CertFile     string `json:"cert_file"`
+	KeyFile      string `json:"key_file"`
+	ClientCAFile string `json:"client_ca_file,omitempty"`
+	MinVersion   string `json:"min_version,omitempty"`
+}
+
+// ACMEConfig configures automatic certificate retrieval and renewal via
+// the ACME protocol (e.g. Let's Encrypt) for a listener.
+type ACMEConfig struct {
+	Domains  []string `json:"domains"`
+	CacheDir string   `json:"cache_dir"`
+	Email    string   `json:"email,omitempty"`
+}
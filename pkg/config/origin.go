@@ -0,0 +1,8 @@
+package config
+
+// OriginConfig configures a single data source the catalog pulls its
+// series and metrics from. Its structure is opaque to the server
+// package, which only threads it through to catalog.NewOrigin.
+type OriginConfig struct {
+	Providers map[string]interface{} `json:"providers,omitempty"`
+}
@@ -0,0 +1,19 @@
+package config
+
+// RateLimitConfig sets a token-bucket rate limit on the bytes read from
+// and written to each client connection accepted by the server's
+// listeners, to protect it against clients pulling large catalog or
+// library dumps in a tight loop.
+//
+// Paths adds further limits for requests whose URL path starts with the
+// given prefix, letting e.g. catalog browsing be throttled more
+// aggressively than static assets. The longest matching prefix wins. A
+// path limit applies on top of the per-connection limits above rather
+// than replacing them, so it can tighten them but not loosen them.
+type RateLimitConfig struct {
+	ReadBytesPerSec  int `json:"read_bytes_per_sec,omitempty"`
+	WriteBytesPerSec int `json:"write_bytes_per_sec,omitempty"`
+	BurstBytes       int `json:"burst_bytes,omitempty"`
+
+	Paths map[string]*RateLimitConfig `json:"paths,omitempty"`
+}
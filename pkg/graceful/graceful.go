@@ -0,0 +1,176 @@
+// Package graceful implements zero-downtime restarts of a listening
+// server by inheriting its bound socket across a fork/exec cycle,
+// following the systemd socket-activation convention (LISTEN_FDS /
+// LISTEN_PID).
+package graceful
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+const (
+	envListenFDs   string  = "LISTEN_FDS"
+	envListenPID   string  = "LISTEN_PID"
+	listenFDsStart uintptr = 3
+)
+
+// Listen returns a net.Listener bound to address on network. index is the
+// position of this listener among all the listeners the server starts
+// (0, 1, 2, ...); it is used to pick the matching inherited file
+// descriptor when this process was spawned by Restart, or by systemd
+// socket activation.
+func Listen(index int, network, address string) (net.Listener, error) {
+	listener, err := listenerFromEnv(index)
+	if err != nil {
+		return nil, err
+	} else if listener != nil {
+		return listener, nil
+	}
+
+	return net.Listen(network, address)
+}
+
+// listenerFromEnv reconstructs the listener at index from the file
+// descriptors passed by a parent process via LISTEN_FDS/LISTEN_PID. It
+// returns a nil listener, with no error, when no matching descriptor was
+// inherited.
+//
+// Real systemd socket activation sets LISTEN_PID to the pid of the
+// process meant to consume the descriptors, which it can do because it
+// forks before exec. Restart can't: Go's os.StartProcess performs the
+// fork and exec as a single call, so the new pid isn't known until after
+// the child is already running, too late to bake into its environment.
+// Restart sets LISTEN_PID to its own pid instead, and since that process
+// is this one's parent immediately after exec, LISTEN_PID is accepted
+// when it matches either os.Getpid() (systemd) or os.Getppid() (Restart).
+func listenerFromEnv(index int) (net.Listener, error) {
+	pid := os.Getenv(envListenPID)
+	if pid == "" || (pid != strconv.Itoa(os.Getpid()) && pid != strconv.Itoa(os.Getppid())) {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv(envListenFDs))
+	if err != nil || count <= index {
+		return nil, nil
+	}
+
+	file := os.NewFile(listenFDsStart+uintptr(index), "graceful-listener")
+	defer file.Close()
+
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to inherit listener: %s", err)
+	}
+
+	return listener, nil
+}
+
+// ClearInheritedEnv removes LISTEN_FDS and LISTEN_PID from the process
+// environment. It must be called once every listener the server starts
+// has had a chance to inherit its descriptor via Listen, so that any
+// subprocess this process execs afterwards doesn't also try to treat its
+// own fd 3+ as inherited listeners.
+func ClearInheritedEnv() {
+	os.Unsetenv(envListenFDs)
+	os.Unsetenv(envListenPID)
+}
+
+// Listener wraps a net.Listener, adding the ability to recover its
+// underlying file descriptor for a graceful restart. Draining in-flight
+// connections and stopping accepting new ones on shutdown is handled by
+// http.Server.Shutdown, which this type's embedded net.Listener already
+// satisfies.
+type Listener struct {
+	net.Listener
+}
+
+// NewListener wraps listener so its file descriptor can be recovered via
+// Fd for a graceful restart.
+func NewListener(listener net.Listener) *Listener {
+	return &Listener{Listener: listener}
+}
+
+// fileConn is implemented by the net.Listener types backed by a single
+// os.File, such as *net.TCPListener and *net.UnixListener.
+type fileConn interface {
+	File() (*os.File, error)
+}
+
+// Unwrapper is implemented by listener wrappers (TLS, rate limiting, ...)
+// that sit between Listener and the real, file-backed listener. Fd walks
+// through a chain of these to reach it, so wrapping a listener never
+// breaks its ability to be inherited across a restart.
+type Unwrapper interface {
+	Unwrap() net.Listener
+}
+
+// Fd returns the underlying file descriptor of the listener, as an
+// *os.File the caller owns and is responsible for closing, suitable for
+// passing to a forked child process via os.ProcAttr.Files. It unwraps
+// any number of Unwrapper layers (TLS, rate limiting, ...) to find it.
+//
+// The returned File is a dup of the listener's descriptor (per the
+// documented contract of the stdlib File methods backing fileConn), not
+// the listener's own fd, so closing it doesn't affect the listener
+// itself. The caller must still close it once done with it (e.g. once
+// Restart has duplicated it into the child) to avoid leaking it.
+func (l *Listener) Fd() (*os.File, error) {
+	listener := l.Listener
+
+	for {
+		if fc, ok := listener.(fileConn); ok {
+			return fc.File()
+		}
+
+		unwrapper, ok := listener.(Unwrapper)
+		if !ok {
+			return nil, fmt.Errorf("listener type %T cannot be inherited", listener)
+		}
+
+		listener = unwrapper.Unwrap()
+	}
+}
+
+// Restart forks a copy of the running binary, passing listenerFiles
+// through in order so the child can inherit the listening sockets via
+// LISTEN_FDS/LISTEN_PID, at the same indices the parent started them at.
+// LISTEN_PID is set to this process's own pid; see listenerFromEnv for
+// why the child validates against its parent pid rather than its own.
+// Each of listenerFiles is closed, once os.StartProcess has duplicated
+// it into the child, whether or not the restart succeeds.
+func Restart(listenerFiles []*os.File) (*os.Process, error) {
+	defer func() {
+		for _, file := range listenerFiles {
+			file.Close()
+		}
+	}()
+
+	execPath, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	files := append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, listenerFiles...)
+
+	process, err := os.StartProcess(execPath, os.Args, &os.ProcAttr{
+		Dir: wd,
+		Env: append(os.Environ(),
+			fmt.Sprintf("%s=%d", envListenFDs, len(listenerFiles)),
+			fmt.Sprintf("%s=%d", envListenPID, os.Getpid()),
+		),
+		Files: files,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to restart process: %s", err)
+	}
+
+	return process, nil
+}
@@ -0,0 +1,54 @@
+package graceful
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestListenerFromEnvRejectsWrongPID(t *testing.T) {
+	defer os.Unsetenv(envListenFDs)
+	defer os.Unsetenv(envListenPID)
+
+	os.Setenv(envListenFDs, "1")
+	wrongPID := os.Getppid() + 1
+	if wrongPID == os.Getpid() {
+		wrongPID++
+	}
+	os.Setenv(envListenPID, strconv.Itoa(wrongPID))
+
+	listener, err := listenerFromEnv(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if listener != nil {
+		t.Fatal("expected no listener to be inherited when LISTEN_PID matches neither this process's pid nor its parent's")
+	}
+}
+
+func TestListenerFromEnvNoEnv(t *testing.T) {
+	os.Unsetenv(envListenFDs)
+	os.Unsetenv(envListenPID)
+
+	listener, err := listenerFromEnv(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if listener != nil {
+		t.Fatal("expected no listener to be inherited when LISTEN_PID is unset")
+	}
+}
+
+func TestClearInheritedEnv(t *testing.T) {
+	os.Setenv(envListenFDs, "1")
+	os.Setenv(envListenPID, fmt.Sprintf("%d", os.Getppid()))
+
+	ClearInheritedEnv()
+
+	if os.Getenv(envListenFDs) != "" || os.Getenv(envListenPID) != "" {
+		t.Fatal("expected ClearInheritedEnv to unset both LISTEN_FDS and LISTEN_PID")
+	}
+}
@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// jsonLogger writes one JSON object per line, selectable as the "json"
+// LogFormat for ingestion by external log-processing pipelines.
+type jsonLogger struct {
+	output *outputRef
+	level  Level
+	fields []field
+}
+
+func newJSONLogger(output io.Writer, level Level) Logger {
+	return &jsonLogger{output: newOutputRef(output), level: level}
+}
+
+func (l *jsonLogger) log(level Level, format string, args ...interface{}) {
+	if level < l.level {
+		return
+	}
+
+	entry := make(map[string]interface{}, len(l.fields)+3)
+	entry["time"] = time.Now().Format(time.RFC3339)
+	entry["level"] = strings.ToLower(levelNames[level])
+	entry["message"] = fmt.Sprintf(format, args...)
+
+	for _, f := range l.fields {
+		entry[f.key] = f.value
+	}
+
+	data, err := json.Marshal(entry)
+	if err == nil {
+		l.output.mu.Lock()
+		l.output.w.Write(append(data, '\n'))
+		l.output.mu.Unlock()
+	}
+
+	if level == LevelFatal {
+		os.Exit(1)
+	}
+}
+
+func (l *jsonLogger) Debug(format string, args ...interface{})   { l.log(LevelDebug, format, args...) }
+func (l *jsonLogger) Info(format string, args ...interface{})    { l.log(LevelInfo, format, args...) }
+func (l *jsonLogger) Notice(format string, args ...interface{})  { l.log(LevelNotice, format, args...) }
+func (l *jsonLogger) Warning(format string, args ...interface{}) { l.log(LevelWarning, format, args...) }
+func (l *jsonLogger) Error(format string, args ...interface{})   { l.log(LevelError, format, args...) }
+func (l *jsonLogger) Fatal(format string, args ...interface{})   { l.log(LevelFatal, format, args...) }
+
+func (l *jsonLogger) With(key string, value interface{}) Logger {
+	fields := make([]field, len(l.fields), len(l.fields)+1)
+	copy(fields, l.fields)
+	fields = append(fields, field{key: key, value: value})
+
+	return &jsonLogger{output: l.output, level: l.level, fields: fields}
+}
+
+func (l *jsonLogger) SetOutput(output io.Writer) {
+	l.output.set(output)
+}
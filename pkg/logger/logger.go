@@ -0,0 +1,107 @@
+// Package logger provides a leveled, structured logging interface used
+// throughout the server, in place of scattered package-level
+// log.Printf("NOTICE: ...") calls.
+package logger
+
+import (
+	"io"
+	"strings"
+	"sync"
+)
+
+// Level represents a logger's verbosity threshold.
+type Level int
+
+// Available log levels, from most to least verbose.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelNotice
+	LevelWarning
+	LevelError
+	LevelFatal
+)
+
+var levelNames = map[Level]string{
+	LevelDebug:   "DEBUG",
+	LevelInfo:    "INFO",
+	LevelNotice:  "NOTICE",
+	LevelWarning: "WARNING",
+	LevelError:   "ERROR",
+	LevelFatal:   "FATAL",
+}
+
+// ParseLevel converts a level name such as "warning" to a Level, falling
+// back to LevelInfo when name does not match any known level.
+func ParseLevel(name string) Level {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(levelName, name) {
+			return level
+		}
+	}
+
+	return LevelInfo
+}
+
+// Logger is a leveled, structured logger. With returns a child Logger
+// that annotates every subsequent entry with an extra key/value pair,
+// letting callers attach context (e.g. a component name) once instead of
+// repeating it in every message.
+type Logger interface {
+	Debug(format string, args ...interface{})
+	Info(format string, args ...interface{})
+	Notice(format string, args ...interface{})
+	Warning(format string, args ...interface{})
+	Error(format string, args ...interface{})
+	Fatal(format string, args ...interface{})
+
+	With(key string, value interface{}) Logger
+
+	// SetOutput redirects where entries are written, used to reopen the
+	// log file after it has been rotated out from under the process.
+	SetOutput(output io.Writer)
+}
+
+// field is a single key/value pair attached via Logger.With.
+type field struct {
+	key   string
+	value interface{}
+}
+
+// outputRef is a mutable, concurrency-safe holder for a Logger's
+// destination writer. A Logger and every child derived from it via With
+// share the same outputRef, so that SetOutput on any one of them — the
+// top-level server logger calls it after reopening a rotated log file —
+// is also picked up by every derived logger instead of only the one it
+// was called on.
+type outputRef struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newOutputRef(w io.Writer) *outputRef {
+	return &outputRef{w: w}
+}
+
+func (r *outputRef) set(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w = w
+}
+
+// New returns the default, human-readable Logger, selectable as the
+// "text" LogFormat.
+func New(output io.Writer, level Level) Logger {
+	return &textLogger{output: newOutputRef(output), level: level}
+}
+
+// NewFromConfig returns the Logger implementation named by format ("text"
+// or "json"; anything else falls back to "text"), writing to output at
+// the given level.
+func NewFromConfig(output io.Writer, format string, level Level) Logger {
+	if format == "json" {
+		return newJSONLogger(output, level)
+	}
+
+	return New(output, level)
+}
@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWithSharesOutput(t *testing.T) {
+	var buf bytes.Buffer
+
+	parent := New(&buf, LevelInfo)
+	child := parent.With("component", "catalog")
+
+	var rotated bytes.Buffer
+	parent.SetOutput(&rotated)
+
+	child.Info("hello")
+
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing written to the old output, got %q", buf.String())
+	}
+
+	if !strings.Contains(rotated.String(), "hello") {
+		t.Fatalf("expected the child logger to follow the parent's SetOutput, got %q", rotated.String())
+	}
+}
+
+func TestLogLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+
+	l := New(&buf, LevelWarning)
+	l.Info("should not appear")
+	l.Warning("should appear")
+
+	if strings.Contains(buf.String(), "should not appear") {
+		t.Fatalf("expected entries below the configured level to be dropped, got %q", buf.String())
+	}
+
+	if !strings.Contains(buf.String(), "should appear") {
+		t.Fatalf("expected entries at or above the configured level to be written, got %q", buf.String())
+	}
+}
@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// textLogger writes "LEVEL: message key=value ..." lines, matching the
+// server's historical log.Printf convention.
+type textLogger struct {
+	output *outputRef
+	level  Level
+	fields []field
+}
+
+func (l *textLogger) log(level Level, format string, args ...interface{}) {
+	if level < l.level {
+		return
+	}
+
+	l.output.mu.Lock()
+	fmt.Fprintf(l.output.w, "%s: %s%s\n", levelNames[level], fmt.Sprintf(format, args...), formatFields(l.fields))
+	l.output.mu.Unlock()
+
+	if level == LevelFatal {
+		os.Exit(1)
+	}
+}
+
+func formatFields(fields []field) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%v", f.key, f.value)
+	}
+
+	return b.String()
+}
+
+func (l *textLogger) Debug(format string, args ...interface{})   { l.log(LevelDebug, format, args...) }
+func (l *textLogger) Info(format string, args ...interface{})    { l.log(LevelInfo, format, args...) }
+func (l *textLogger) Notice(format string, args ...interface{})  { l.log(LevelNotice, format, args...) }
+func (l *textLogger) Warning(format string, args ...interface{}) { l.log(LevelWarning, format, args...) }
+func (l *textLogger) Error(format string, args ...interface{})   { l.log(LevelError, format, args...) }
+func (l *textLogger) Fatal(format string, args ...interface{})   { l.log(LevelFatal, format, args...) }
+
+func (l *textLogger) With(key string, value interface{}) Logger {
+	fields := make([]field, len(l.fields), len(l.fields)+1)
+	copy(fields, l.fields)
+	fields = append(fields, field{key: key, value: value})
+
+	return &textLogger{output: l.output, level: l.level, fields: fields}
+}
+
+func (l *textLogger) SetOutput(output io.Writer) {
+	l.output.set(output)
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	"github.com/facette/facette/pkg/config"
+	"github.com/facette/facette/pkg/graceful"
+	"github.com/facette/facette/thirdparty/golang.org/x/crypto/acme/autocert"
+	"github.com/facette/facette/thirdparty/golang.org/x/sync/errgroup"
+)
+
+var tlsMinVersions = map[string]uint16{
+	"tls1.0": tls.VersionTLS10,
+	"tls1.1": tls.VersionTLS11,
+	"tls1.2": tls.VersionTLS12,
+}
+
+// listenerConfigs returns the listeners to start from the server
+// configuration, falling back to a single plain TCP listener on
+// Config.BindAddr when none are configured, for backwards compatibility.
+func (server *Server) listenerConfigs() []config.ListenerConfig {
+	if len(server.Config.Listeners) > 0 {
+		return server.Config.Listeners
+	}
+
+	return []config.ListenerConfig{{Network: "tcp", Address: server.Config.BindAddr}}
+}
+
+// startListeners binds every configured listener, wrapping each with TLS
+// or ACME-managed certificates as requested, and pairs it with an
+// *http.Server tied to the server's root context so that cancelling it
+// drains the listener via Shutdown.
+func (server *Server) startListeners() error {
+	for index, listenerConfig := range server.listenerConfigs() {
+		network := listenerConfig.Network
+		if network == "" {
+			network = "tcp"
+		}
+
+		rawListener, err := graceful.Listen(index, network, listenerConfig.Address)
+		if err != nil {
+			return fmt.Errorf("unable to listen on `%s': %s", listenerConfig.Address, err)
+		}
+
+		rawListener = newThrottledListener(rawListener, server.Config.RateLimit)
+
+		rawListener, err = wrapListenerTLS(rawListener, listenerConfig)
+		if err != nil {
+			return err
+		}
+
+		server.logger.Info("server listening on %s", listenerConfig.Address)
+
+		server.Listeners = append(server.Listeners, graceful.NewListener(rawListener))
+		server.httpServers = append(server.httpServers, &http.Server{
+			BaseContext: func(net.Listener) context.Context { return server.ctx },
+		})
+	}
+
+	// Every listener has now had its chance to inherit a descriptor from
+	// a parent set up by Restart; drop the env vars so a subprocess this
+	// process execs later doesn't also try to claim them.
+	graceful.ClearInheritedEnv()
+
+	return nil
+}
+
+// wrapListenerTLS wraps listener with a tls.Config built from the ACME or
+// static TLS settings of cfg; it returns listener unchanged when neither
+// is set.
+func wrapListenerTLS(listener net.Listener, cfg config.ListenerConfig) (net.Listener, error) {
+	switch {
+	case cfg.ACME != nil:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.ACME.Domains...),
+			Cache:      autocert.DirCache(cfg.ACME.CacheDir),
+			Email:      cfg.ACME.Email,
+		}
+
+		return newTLSListener(listener, manager.TLSConfig()), nil
+
+	case cfg.TLS != nil:
+		tlsConfig, err := buildTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+
+		return newTLSListener(listener, tlsConfig), nil
+	}
+
+	return listener, nil
+}
+
+// tlsListener wraps the net.Listener returned by tls.NewListener, which
+// embeds its underlying listener as an unexported field and so loses its
+// File method. Keeping our own reference to that underlying listener lets
+// Fd still recover it, via Unwrap, for a graceful restart.
+type tlsListener struct {
+	net.Listener
+
+	raw net.Listener
+}
+
+func newTLSListener(listener net.Listener, tlsConfig *tls.Config) net.Listener {
+	return &tlsListener{Listener: tls.NewListener(listener, tlsConfig), raw: listener}
+}
+
+// Unwrap returns the listener underneath the TLS handshake wrapping.
+func (l *tlsListener) Unwrap() net.Listener {
+	return l.raw
+}
+
+// buildTLSConfig turns a config.TLSConfig into a *tls.Config, loading the
+// certificate and, when set, the client CA used to require mutual TLS.
+func buildTLSConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load TLS certificate: %s", err)
+	}
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if version, ok := tlsMinVersions[cfg.MinVersion]; ok {
+		tlsConfig.MinVersion = version
+	}
+
+	if cfg.ClientCAFile != "" {
+		pemData, err := ioutil.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client CA file `%s': %s", cfg.ClientCAFile, err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("unable to parse client CA file `%s'", cfg.ClientCAFile)
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// serveListeners runs each listener's paired http.Server concurrently,
+// blocking until all of them have stopped. http.ErrServerClosed, which
+// every one of them reports after a Shutdown, is swallowed so only a
+// genuine serving error is returned.
+func (server *Server) serveListeners(handler http.Handler) error {
+	handler = throttleMiddleware(handler, server.Config.RateLimit)
+
+	var group errgroup.Group
+
+	for index, listener := range server.Listeners {
+		listener := listener
+		httpServer := server.httpServers[index]
+		httpServer.Handler = handler
+
+		group.Go(func() error {
+			if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+				return err
+			}
+
+			return nil
+		})
+	}
+
+	return group.Wait()
+}
+
+// shutdownListeners calls Shutdown on every listener's http.Server,
+// stopping it from accepting new connections and waiting for in-flight
+// ones to finish, up to ctx's deadline.
+func (server *Server) shutdownListeners(ctx context.Context) {
+	var group errgroup.Group
+
+	for _, httpServer := range server.httpServers {
+		httpServer := httpServer
+
+		group.Go(func() error {
+			return httpServer.Shutdown(ctx)
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		server.logger.Warning("HTTP server did not shut down cleanly: %s", err.Error())
+	}
+}
@@ -2,24 +2,27 @@
 package server
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"net"
+	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"strconv"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/facette/facette/pkg/catalog"
 	"github.com/facette/facette/pkg/config"
+	"github.com/facette/facette/pkg/graceful"
 	"github.com/facette/facette/pkg/library"
+	"github.com/facette/facette/pkg/logger"
 	"github.com/facette/facette/pkg/worker"
-	"github.com/facette/facette/thirdparty/github.com/etix/stoppableListener"
 )
 
 const (
-	serverStopWait int    = 10
 	urlStaticPath  string = "/static/"
 	urlAdminPath   string = "/admin/"
 	urlBrowsePath  string = "/browse/"
@@ -27,44 +30,65 @@ const (
 	urlCatalogPath string = "/api/v1/catalog/"
 	urlLibraryPath string = "/api/v1/library/"
 	urlStatsPath   string = "/api/v1/stats"
+
+	defaultShutdownTimeout int = 60
 )
 
 // Server is the main structure of the server handler.
 type Server struct {
 	Config        *config.Config
-	Listener      *stoppableListener.StoppableListener
+	Listeners     []*graceful.Listener
 	Catalog       *catalog.Catalog
 	Library       *library.Library
 	originWorkers worker.WorkerPool
 	catalogWorker *worker.Worker
-	Loading       bool
 	StartTime     time.Time
-	debugLevel    int
+
+	httpServers []*http.Server
+	ctx         context.Context
+	cancel      context.CancelFunc
+	loading     atomic.Value // bool
+
+	logger     logger.Logger
+	logLevel   logger.Level
+	logFile    *os.File
+	restarting bool
 }
 
 // NewServer creates a new instance of server.
-func NewServer(configPath string, debugLevel int) *Server {
+func NewServer(configPath string, logLevel logger.Level) *Server {
 	return &Server{
-		Config:     &config.Config{Path: configPath},
-		debugLevel: debugLevel,
+		Config:   &config.Config{Path: configPath},
+		logger:   logger.New(os.Stderr, logLevel),
+		logLevel: logLevel,
 	}
 }
 
+// Loading reports whether the server is currently (re)loading its
+// configuration and catalog/library data.
+func (server *Server) Loading() bool {
+	loading, _ := server.loading.Load().(bool)
+	return loading
+}
+
+func (server *Server) setLoading(loading bool) {
+	server.loading.Store(loading)
+}
+
 // Reload reloads the configuration and refreshes both catalog and library.
 func (server *Server) Reload() error {
-	log.Printf("NOTICE: reloading server")
+	server.logger.Notice("reloading server")
 
-	server.Loading = true
+	server.setLoading(true)
+	defer server.setLoading(false)
 
 	if err := server.Config.Reload(); err != nil {
-		log.Printf("ERROR: an error occurred while reloading configuration: %s", err.Error())
+		server.logger.Error("an error occurred while reloading configuration: %s", err.Error())
 		return err
 	}
 
-	server.originWorkers.Broadcast(eventCatalogRefresh, nil)
-	server.Library.Refresh()
-
-	server.Loading = false
+	server.originWorkers.Broadcast(server.ctx, eventCatalogRefresh, nil)
+	server.Library.Refresh(server.ctx)
 
 	return nil
 }
@@ -73,27 +97,36 @@ func (server *Server) Reload() error {
 func (server *Server) Run() error {
 	server.StartTime = time.Now()
 
+	server.ctx, server.cancel = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer server.cancel()
+
 	// Load server configuration
 	if err := server.Config.Reload(); err != nil {
 		return err
 	}
 
-	// Set server logging ouput
-	if server.Config.ServerLog != "" && server.Config.ServerLog != "-" {
-		dirPath, _ := path.Split(server.Config.ServerLog)
-		os.MkdirAll(dirPath, 0755)
+	// Set up structured logging, reopening ServerLog on disk if configured
+	logOutput := io.Writer(os.Stderr)
 
-		serverOutput, err := os.OpenFile(server.Config.ServerLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if server.Config.ServerLog != "" && server.Config.ServerLog != "-" {
+		logFile, err := server.openServerLog()
 		if err != nil {
-			fmt.Errorf("unable to open log file `%s'", server.Config.ServerLog)
-			return err
+			return fmt.Errorf("unable to open log file `%s': %s", server.Config.ServerLog, err)
 		}
 
-		defer serverOutput.Close()
+		server.logFile = logFile
+		defer server.logFile.Close()
 
-		log.SetOutput(serverOutput)
+		logOutput = logFile
 	}
 
+	logLevel := server.logLevel
+	if server.Config.LogLevel != "" {
+		logLevel = logger.ParseLevel(server.Config.LogLevel)
+	}
+
+	server.logger = logger.NewFromConfig(logOutput, server.Config.LogFormat, logLevel)
+
 	// Handle pid file creation if set
 	if server.Config.PidFile != "" {
 		fd, err := os.OpenFile(server.Config.PidFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
@@ -107,7 +140,7 @@ func (server *Server) Run() error {
 	}
 
 	// Create new catalog instance
-	server.Catalog = catalog.NewCatalog(server.Config, server.debugLevel)
+	server.Catalog = catalog.NewCatalog(server.Config, server.logger.With("component", "catalog"))
 
 	// Set up origins from configuration
 	for originName, originConfig := range server.Config.Origins {
@@ -120,23 +153,23 @@ func (server *Server) Run() error {
 	server.catalogWorker.RegisterEvent(eventShutdown, workerCatalogShutdown)
 	server.catalogWorker.RegisterEvent(eventRun, workerCatalogRun)
 
-	if err := server.catalogWorker.SendEvent(eventInit, false, server.Catalog); err != nil {
+	if err := server.catalogWorker.SendEvent(server.ctx, eventInit, false, server.Catalog); err != nil {
 		return err
 	}
 
-	server.catalogWorker.SendEvent(eventRun, true, nil)
+	server.catalogWorker.SendEvent(server.ctx, eventRun, true, nil)
 
 	// Instanciate origin workers
-	if err := server.startOriginWorkers(); err != nil {
+	if err := server.startOriginWorkers(server.ctx); err != nil {
 		return err
 	}
 
 	// Send initial catalog refresh event to origin workers
-	server.originWorkers.Broadcast(eventCatalogRefresh, nil)
+	server.originWorkers.Broadcast(server.ctx, eventCatalogRefresh, nil)
 
 	// Create library instance
-	server.Library = library.NewLibrary(server.Config, server.Catalog, server.debugLevel)
-	go server.Library.Refresh()
+	server.Library = library.NewLibrary(server.Config, server.Catalog, server.logger.With("component", "library"))
+	go server.Library.Refresh(server.ctx)
 
 	// Prepare router
 	router := NewRouter(server)
@@ -151,65 +184,196 @@ func (server *Server) Run() error {
 
 	router.HandleFunc("/", server.serveBrowse)
 
-	http.Handle("/", router)
-
-	// Start serving HTTP requests
-	listener, err := net.Listen("tcp", server.Config.BindAddr)
-	if err != nil {
+	// Start serving HTTP requests on every configured listener, reusing
+	// inherited sockets if this process was spawned by Restart
+	if err := server.startListeners(); err != nil {
 		return err
 	}
 
-	log.Printf("INFO: server listening on %s", server.Config.BindAddr)
+	server.handleSignals()
 
-	server.Listener = stoppableListener.Handle(listener)
-	err = http.Serve(server.Listener, nil)
+	shutdownDone := make(chan struct{})
 
-	// Server shutdown triggered
-	if server.Listener.Stopped {
-		// Shutdown running origin workers
-		server.StopOriginWorkers()
+	go func() {
+		<-server.ctx.Done()
+		server.shutdown()
+		close(shutdownDone)
+	}()
+
+	err := server.serveListeners(router)
 
-		// Shutdown catalog worker
-		if err := server.catalogWorker.SendEvent(eventShutdown, false, nil); err != nil {
-			log.Printf("WARNING: catalog worker did not shut down successfully: %s", err)
+	// Server shutdown triggered
+	if server.ctx.Err() != nil || server.restarting {
+		// serveListeners returns as soon as every listener is closed, which
+		// Shutdown does before it starts waiting on in-flight connections;
+		// wait for the shutdown sequence itself to finish so we don't race
+		// draining connections, stopping workers, and closing the catalog
+		// against the process exiting.
+		<-shutdownDone
+
+		server.logger.Notice("server stopped gracefully")
+
+		// Remove pid file, unless a new process has taken over via Restart
+		if server.Config.PidFile != "" && !server.restarting {
+			os.Remove(server.Config.PidFile)
 		}
 
-		// Close catalog
-		server.Catalog.Close()
+		return nil
+	}
 
-		/* Wait for the clients to disconnect */
-		for i := 0; i < serverStopWait; i++ {
-			if clientCount := server.Listener.ConnCount.Get(); clientCount == 0 {
-				break
-			}
+	return err
+}
 
-			time.Sleep(time.Second) // TODO: WTF? Use a waitgroup or proper timeout system
-		}
+// shutdown runs the graceful shutdown sequence triggered by the root
+// context being cancelled: HTTP servers are drained first, then
+// background workers are told to stop, and finally the catalog is closed.
+func (server *Server) shutdown() {
+	shutdownCtx, cancel := server.shutdownContext()
+	defer cancel()
+
+	server.shutdownListeners(shutdownCtx)
 
-		clientCount := server.Listener.ConnCount.Get()
+	server.StopOriginWorkers()
+
+	if err := server.catalogWorker.SendEvent(shutdownCtx, eventShutdown, false, nil); err != nil {
+		server.logger.Warning("catalog worker did not shut down successfully: %s", err)
+	}
+
+	server.Catalog.Close()
+}
+
+// shutdownContext returns the context bounding how long shutdown waits
+// for in-flight requests to finish, per Config.ShutdownTimeout: a
+// negative value (left by a configuration file that doesn't set it)
+// falls back to defaultShutdownTimeout, while 0 disables the deadline
+// outright so shutdown waits as long as it takes to drain every
+// connection.
+func (server *Server) shutdownContext() (context.Context, context.CancelFunc) {
+	timeout := server.Config.ShutdownTimeout
+	if timeout < 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	if timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+}
 
-		if clientCount > 0 {
-			log.Printf("INFO: server stopped after %d second(s) with %d client(s) still connected",
-				serverStopWait,
-				clientCount)
-		} else {
-			log.Println("INFO: server stopped gracefully")
+// Stop stops the server, waiting for in-flight requests to drain before
+// the process exits.
+func (server *Server) Stop() {
+	server.logger.Notice("shutting down server")
+
+	server.cancel()
+}
+
+// Restart performs a zero-downtime restart of the server: a copy of the
+// running binary is forked with every listening socket inherited as file
+// descriptors 3 and up, so the new process can start serving requests
+// immediately.
+// The current process stops accepting connections and keeps serving the
+// ones already in flight until shutdown's drain completes.
+func (server *Server) Restart() error {
+	server.logger.Notice("restarting server")
+
+	// Rename our log file out of the way so the new process starts a
+	// fresh one at the configured path instead of both processes writing
+	// to the same file
+	if server.logFile != nil {
+		rotatedPath := fmt.Sprintf("%s.%d", server.Config.ServerLog, os.Getpid())
+		if err := os.Rename(server.Config.ServerLog, rotatedPath); err != nil {
+			server.logger.Warning("unable to rename log file for restart: %s", err.Error())
 		}
+	}
 
-		// Remove pid file
-		if server.Config.PidFile != "" {
-			os.Remove(server.Config.PidFile)
+	files := make([]*os.File, len(server.Listeners))
+	for index, listener := range server.Listeners {
+		file, err := listener.Fd()
+		if err != nil {
+			return fmt.Errorf("unable to restart server: %s", err.Error())
 		}
-	} else if err != nil {
+
+		files[index] = file
+	}
+
+	process, err := graceful.Restart(files)
+	if err != nil {
 		return err
 	}
 
+	server.logger.Info("spawned new server process with pid %d", process.Pid)
+
+	server.restarting = true
+	server.cancel()
+
 	return nil
 }
 
-// Stop stops the server.
-func (server *Server) Stop() {
-	log.Printf("NOTICE: shutting down server")
+// openServerLog opens ServerLog for appending, creating its parent
+// directory if necessary.
+func (server *Server) openServerLog() (*os.File, error) {
+	dirPath, _ := path.Split(server.Config.ServerLog)
+	os.MkdirAll(dirPath, 0755)
+
+	return os.OpenFile(server.Config.ServerLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+}
+
+// reopenLog closes and reopens ServerLog, so external log rotation (e.g.
+// logrotate(8)) takes effect without restarting the process.
+func (server *Server) reopenLog() {
+	if server.logFile == nil {
+		return
+	}
+
+	logFile, err := server.openServerLog()
+	if err != nil {
+		server.logger.Error("unable to reopen log file: %s", err.Error())
+		return
+	}
+
+	previous := server.logFile
+	server.logFile = logFile
+	server.logger.SetOutput(logFile)
+	previous.Close()
+
+	server.logger.Notice("reopened log file")
+}
+
+// handleSignals wires SIGHUP to Reload, SIGUSR1 to a log file reopen for
+// log rotation, and SIGUSR2 to Restart for a zero-downtime upgrade.
+// Interrupt and SIGTERM are handled separately, by the root context
+// created in Run.
+func (server *Server) handleSignals() {
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+
+	reopenSignals := make(chan os.Signal, 1)
+	signal.Notify(reopenSignals, syscall.SIGUSR1)
 
-	server.Listener.Stop <- true
+	restartSignals := make(chan os.Signal, 1)
+	signal.Notify(restartSignals, syscall.SIGUSR2)
+
+	go func() {
+		for range reloadSignals {
+			if err := server.Reload(); err != nil {
+				server.logger.Error("unable to reload server: %s", err.Error())
+			}
+		}
+	}()
+
+	go func() {
+		for range reopenSignals {
+			server.reopenLog()
+		}
+	}()
+
+	go func() {
+		for range restartSignals {
+			if err := server.Restart(); err != nil {
+				server.logger.Error("unable to restart server: %s", err.Error())
+			}
+		}
+	}()
 }
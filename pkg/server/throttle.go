@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/facette/facette/pkg/config"
+	"github.com/facette/facette/thirdparty/golang.org/x/time/rate"
+)
+
+const defaultBurstBytes int = 32 * 1024
+
+// throttledListener wraps a net.Listener so every connection it accepts
+// has its read and write throughput capped by a token bucket, protecting
+// the server from clients pulling large catalog or library dumps in a
+// tight loop. Each connection gets its own pair of buckets, built lazily
+// in Accept, so one busy client can't eat into another client's share of
+// a bucket shared across the whole listener.
+type throttledListener struct {
+	net.Listener
+
+	cfg *config.RateLimitConfig
+}
+
+// newThrottledListener wraps listener with the limits described by cfg.
+// It returns listener unchanged when cfg is nil.
+func newThrottledListener(listener net.Listener, cfg *config.RateLimitConfig) net.Listener {
+	if cfg == nil {
+		return listener
+	}
+
+	return &throttledListener{Listener: listener, cfg: cfg}
+}
+
+// Unwrap returns the listener underneath the throttle.
+func (l *throttledListener) Unwrap() net.Listener {
+	return l.Listener
+}
+
+// Accept accepts the next incoming connection and wraps it with a fresh
+// pair of token buckets built from the listener's configured limits.
+func (l *throttledListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	readLimiter, writeLimiter := newLimiters(l.cfg)
+
+	return &throttledConn{Conn: conn, readLimiter: readLimiter, writeLimiter: writeLimiter}, nil
+}
+
+// newLimiters builds a fresh pair of token-bucket limiters from cfg,
+// leaving either nil when the corresponding limit is unset.
+func newLimiters(cfg *config.RateLimitConfig) (readLimiter, writeLimiter *rate.Limiter) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	burst := cfg.BurstBytes
+	if burst <= 0 {
+		burst = defaultBurstBytes
+	}
+
+	if cfg.ReadBytesPerSec > 0 {
+		readLimiter = rate.NewLimiter(rate.Limit(cfg.ReadBytesPerSec), burst)
+	}
+
+	if cfg.WriteBytesPerSec > 0 {
+		writeLimiter = rate.NewLimiter(rate.Limit(cfg.WriteBytesPerSec), burst)
+	}
+
+	return readLimiter, writeLimiter
+}
+
+// throttledConn wraps a net.Conn, pacing every read and write against a
+// token bucket: a write waits for tokens before it is sent, a read waits
+// for tokens once its data has arrived.
+type throttledConn struct {
+	net.Conn
+
+	readLimiter  *rate.Limiter
+	writeLimiter *rate.Limiter
+}
+
+func (c *throttledConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && c.readLimiter != nil {
+		waitN(c.readLimiter, n)
+	}
+
+	return n, err
+}
+
+func (c *throttledConn) Write(b []byte) (int, error) {
+	if c.writeLimiter != nil {
+		waitN(c.writeLimiter, len(b))
+	}
+
+	return c.Conn.Write(b)
+}
+
+// waitN blocks until n bytes' worth of tokens have been taken from
+// limiter, spreading the wait over multiple reservations when n exceeds
+// the bucket's burst size.
+func waitN(limiter *rate.Limiter, n int) {
+	burst := limiter.Burst()
+
+	for n > 0 {
+		chunk := n
+		if chunk > burst {
+			chunk = burst
+		}
+
+		limiter.WaitN(context.Background(), chunk)
+		n -= chunk
+	}
+}
+
+// pathRateLimitConfig returns the entry of cfg.Paths whose key is the
+// longest prefix of path, or nil when none match.
+func pathRateLimitConfig(cfg *config.RateLimitConfig, path string) *config.RateLimitConfig {
+	if cfg == nil {
+		return nil
+	}
+
+	var best *config.RateLimitConfig
+	var bestLen int
+
+	for prefix, override := range cfg.Paths {
+		if len(prefix) > bestLen && strings.HasPrefix(path, prefix) {
+			best = override
+			bestLen = len(prefix)
+		}
+	}
+
+	return best
+}
+
+// throttleMiddleware wraps handler so that requests whose path matches
+// one of cfg.Paths' prefixes have their body reads and response writes
+// paced by that override's limits, layered on top of the per-connection
+// default applied by throttledListener. It returns handler unchanged
+// when cfg has no path overrides configured.
+func throttleMiddleware(handler http.Handler, cfg *config.RateLimitConfig) http.Handler {
+	if cfg == nil || len(cfg.Paths) == 0 {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		override := pathRateLimitConfig(cfg, r.URL.Path)
+		if override == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		readLimiter, writeLimiter := newLimiters(override)
+
+		if readLimiter != nil && r.Body != nil {
+			r.Body = &throttledReadCloser{ReadCloser: r.Body, limiter: readLimiter}
+		}
+
+		if writeLimiter != nil {
+			w = &throttledResponseWriter{ResponseWriter: w, limiter: writeLimiter}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// throttledReadCloser wraps a request body, pacing reads from it against
+// limiter.
+type throttledReadCloser struct {
+	io.ReadCloser
+
+	limiter *rate.Limiter
+}
+
+func (r *throttledReadCloser) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	if n > 0 {
+		waitN(r.limiter, n)
+	}
+
+	return n, err
+}
+
+// throttledResponseWriter wraps a response writer, pacing writes to it
+// against limiter.
+type throttledResponseWriter struct {
+	http.ResponseWriter
+
+	limiter *rate.Limiter
+}
+
+func (w *throttledResponseWriter) Write(b []byte) (int, error) {
+	waitN(w.limiter, len(b))
+	return w.ResponseWriter.Write(b)
+}
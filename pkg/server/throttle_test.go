@@ -0,0 +1,55 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/facette/facette/pkg/config"
+)
+
+func TestNewLimitersPerCall(t *testing.T) {
+	cfg := &config.RateLimitConfig{ReadBytesPerSec: 1024, WriteBytesPerSec: 1024}
+
+	read1, write1 := newLimiters(cfg)
+	read2, write2 := newLimiters(cfg)
+
+	if read1 == nil || write1 == nil || read2 == nil || write2 == nil {
+		t.Fatal("expected non-nil limiters for a configured rate limit")
+	}
+
+	if read1 == read2 || write1 == write2 {
+		t.Fatal("expected newLimiters to build a fresh bucket per call, not share one across connections")
+	}
+}
+
+func TestNewLimitersNilCfg(t *testing.T) {
+	if read, write := newLimiters(nil); read != nil || write != nil {
+		t.Fatal("expected nil limiters when cfg is nil")
+	}
+}
+
+func TestPathRateLimitConfig(t *testing.T) {
+	catalog := &config.RateLimitConfig{ReadBytesPerSec: 1}
+	api := &config.RateLimitConfig{ReadBytesPerSec: 2}
+
+	cfg := &config.RateLimitConfig{
+		Paths: map[string]*config.RateLimitConfig{
+			"/api/":            api,
+			"/api/v1/catalog/": catalog,
+		},
+	}
+
+	cases := []struct {
+		path string
+		want *config.RateLimitConfig
+	}{
+		{"/api/v1/catalog/sources", catalog},
+		{"/api/v1/library/", api},
+		{"/static/style.css", nil},
+	}
+
+	for _, c := range cases {
+		if got := pathRateLimitConfig(cfg, c.path); got != c.want {
+			t.Errorf("pathRateLimitConfig(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+}